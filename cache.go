@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultCacheTTL = 24 * time.Hour
+
+// userCacheEntry is a single cached email -> user ID lookup.
+type userCacheEntry struct {
+	UserID    string    `json:"user_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// teamCache is the cached state for a single Slack workspace (team).
+type teamCache struct {
+	Channels        []channel                 `json:"channels,omitempty"`
+	ChannelTypes    string                    `json:"channel_types,omitempty"`
+	ChannelsUpdated time.Time                 `json:"channels_updated_at"`
+	Users           map[string]userCacheEntry `json:"users,omitempty"`
+}
+
+// cacheFile is the on-disk cache format, keyed by workspace team ID so one
+// cache file can safely serve multiple workspaces.
+type cacheFile struct {
+	Teams map[string]*teamCache `json:"teams"`
+}
+
+// cacheConfig controls lookupCache behavior, set from CLI flags.
+type cacheConfig struct {
+	enabled bool
+	path    string
+	ttl     time.Duration
+	refresh bool
+}
+
+// defaultCachePath returns ~/.slack-multi-channel-invite/cache.json,
+// falling back to a relative path if the home directory can't be
+// determined.
+func defaultCachePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".slack-multi-channel-invite/cache.json"
+	}
+	return filepath.Join(home, ".slack-multi-channel-invite", "cache.json")
+}
+
+func loadCacheFile(path string) (*cacheFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &cacheFile{Teams: make(map[string]*teamCache)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fc cacheFile
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, err
+	}
+	if fc.Teams == nil {
+		fc.Teams = make(map[string]*teamCache)
+	}
+	return &fc, nil
+}
+
+func saveCacheFile(path string, fc *cacheFile) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(fc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0o600)
+}
+
+// lookupCache wraps a slackClient with a persistent on-disk cache of
+// channel listings and email -> user ID lookups, keyed by workspace team
+// ID. When disabled, nothing is read from or written to disk, but
+// lookups made during the run are still memoized in memory (and
+// reverse-resolvable via EmailForUserID) -- disk persistence and
+// in-run memoization are separate concerns. Channels bypasses the cache
+// entirely when disabled, since there's no equivalent single-run reuse
+// for it.
+type lookupCache struct {
+	client        *slackClient
+	cfg           cacheConfig
+	file          *cacheFile
+	team          *teamCache
+	userIDToEmail map[string]string
+	dirty         bool
+}
+
+// newLookupCache loads (or initializes) the cache file and resolves the
+// given workspace team ID's entry. If cfg.enabled is false, the file is
+// never touched and lc.team is a fresh in-memory-only teamCache used
+// purely to memoize lookups for the duration of the run.
+func newLookupCache(client *slackClient, cfg cacheConfig, teamID string) (*lookupCache, error) {
+	lc := &lookupCache{client: client, cfg: cfg, team: &teamCache{}, userIDToEmail: make(map[string]string)}
+	if !cfg.enabled {
+		return lc, nil
+	}
+
+	file, err := loadCacheFile(cfg.path)
+	if err != nil {
+		return nil, err
+	}
+
+	team, ok := file.Teams[teamID]
+	if !ok {
+		team = &teamCache{}
+		file.Teams[teamID] = team
+	}
+
+	lc.file = file
+	lc.team = team
+	for email, entry := range team.Users {
+		lc.userIDToEmail[entry.UserID] = email
+	}
+	return lc, nil
+}
+
+// Channels returns the channel listing for channelTypes, serving from
+// cache when it's fresh (and not forcibly refreshed) and falling through
+// to the API otherwise.
+func (lc *lookupCache) Channels(channelTypes string) ([]channel, error) {
+	if !lc.cfg.enabled {
+		return lc.client.ConversationsList(channelTypes)
+	}
+
+	if !lc.cfg.refresh && lc.team.ChannelTypes == channelTypes && len(lc.team.Channels) > 0 &&
+		time.Since(lc.team.ChannelsUpdated) < lc.cfg.ttl {
+		return lc.team.Channels, nil
+	}
+
+	channels, err := lc.client.ConversationsList(channelTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	lc.team.Channels = channels
+	lc.team.ChannelTypes = channelTypes
+	lc.team.ChannelsUpdated = time.Now()
+	lc.dirty = true
+
+	return channels, nil
+}
+
+// UserID returns the Slack user ID for email, serving from cache when
+// it's fresh (and not forcibly refreshed) and falling through to the API
+// otherwise. The lookup is memoized in memory for the rest of the run
+// even when disk caching (cfg.enabled) is off.
+func (lc *lookupCache) UserID(email string) (string, error) {
+	if !lc.cfg.refresh {
+		if entry, ok := lc.team.Users[email]; ok && time.Since(entry.UpdatedAt) < lc.cfg.ttl {
+			return entry.UserID, nil
+		}
+	}
+
+	userID, err := lc.client.UsersLookupByEmail(email)
+	if err != nil {
+		return "", err
+	}
+
+	if lc.team.Users == nil {
+		lc.team.Users = make(map[string]userCacheEntry)
+	}
+	lc.team.Users[email] = userCacheEntry{UserID: userID, UpdatedAt: time.Now()}
+	lc.userIDToEmail[userID] = email
+	if lc.cfg.enabled {
+		lc.dirty = true
+	}
+
+	return userID, nil
+}
+
+// EmailForUserID reverse-resolves a Slack user ID to the email it was
+// cached under, if any. conversations.members only returns bare user IDs,
+// so this only succeeds for users whose email has separately been looked
+// up (e.g. via UserID) and cached; it returns false otherwise. Backed by
+// a userID -> email index kept alongside team.Users, so this is O(1)
+// regardless of how many users have been looked up.
+func (lc *lookupCache) EmailForUserID(userID string) (string, bool) {
+	email, ok := lc.userIDToEmail[userID]
+	return email, ok
+}
+
+// Flush persists the cache file to disk if anything changed during this
+// run. It's a no-op when caching is disabled.
+func (lc *lookupCache) Flush() error {
+	if !lc.cfg.enabled || !lc.dirty {
+		return nil
+	}
+	return saveCacheFile(lc.cfg.path, lc.file)
+}
@@ -0,0 +1,65 @@
+package main
+
+import "strings"
+
+// channelIndex resolves the channel references an operator passes via
+// -channels to IDs. A bare name (e.g. "general") resolves unambiguously
+// when only one channel has that name; if the same name exists as both a
+// public and a private channel, a bare reference is ambiguous and the
+// operator must disambiguate with a "#name" (public) or "priv:name"
+// (private) prefix.
+type channelIndex struct {
+	byName  map[string]string
+	public  map[string]string
+	private map[string]string
+}
+
+// buildChannelIndex indexes channels (as returned by
+// slackClient.ConversationsList) by name, type and bare name.
+func buildChannelIndex(channels []channel) *channelIndex {
+	idx := &channelIndex{
+		byName:  make(map[string]string),
+		public:  make(map[string]string),
+		private: make(map[string]string),
+	}
+
+	counts := make(map[string]int)
+	for _, ch := range channels {
+		if ch.IsPrivate {
+			idx.private[ch.Name] = ch.ID
+		} else {
+			idx.public[ch.Name] = ch.ID
+		}
+		counts[ch.Name]++
+	}
+
+	for name, count := range counts {
+		if count != 1 {
+			continue // ambiguous -- only resolvable via #name/priv:name prefix
+		}
+		if id, ok := idx.public[name]; ok {
+			idx.byName[name] = id
+		} else {
+			idx.byName[name] = idx.private[name]
+		}
+	}
+
+	return idx
+}
+
+// resolve looks up a channel reference. "#name" and "priv:name" prefixes
+// select the public or private channel of that name explicitly; a bare
+// name resolves only if it's unambiguous.
+func (idx *channelIndex) resolve(ref string) (string, bool) {
+	switch {
+	case strings.HasPrefix(ref, "#"):
+		id, ok := idx.public[strings.TrimPrefix(ref, "#")]
+		return id, ok
+	case strings.HasPrefix(ref, "priv:"):
+		id, ok := idx.private[strings.TrimPrefix(ref, "priv:")]
+		return id, ok
+	default:
+		id, ok := idx.byName[ref]
+		return id, ok
+	}
+}
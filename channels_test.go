@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestChannelIndexResolve(t *testing.T) {
+	channels := []channel{
+		{ID: "C1", Name: "general", IsPrivate: false},
+		{ID: "C2", Name: "eng-team", IsPrivate: false},
+		{ID: "C3", Name: "eng-team", IsPrivate: true},
+		{ID: "C4", Name: "secrets", IsPrivate: true},
+	}
+	idx := buildChannelIndex(channels)
+
+	tests := []struct {
+		name   string
+		ref    string
+		wantID string
+		wantOK bool
+	}{
+		{"unique bare name resolves", "general", "C1", true},
+		{"bare name ambiguous between public/private", "eng-team", "", false},
+		{"explicit # selects the public channel", "#eng-team", "C2", true},
+		{"explicit priv: selects the private channel", "priv:eng-team", "C3", true},
+		{"bare name unambiguous when only private", "secrets", "C4", true},
+		{"unknown bare name", "nope", "", false},
+		{"unknown # name", "#nope", "", false},
+		{"unknown priv: name", "priv:nope", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, ok := idx.resolve(tt.ref)
+			if id != tt.wantID || ok != tt.wantOK {
+				t.Errorf("resolve(%q) = (%q, %v), want (%q, %v)", tt.ref, id, ok, tt.wantID, tt.wantOK)
+			}
+		})
+	}
+}
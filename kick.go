@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+)
+
+// kickResult records the outcome of removing a single user from a single
+// channel, for inclusion in an aggregate report.
+type kickResult struct {
+	Channel    string `json:"channel"`
+	ChannelID  string `json:"channel_id"`
+	Email      string `json:"email"`
+	UserID     string `json:"user_id"`
+	Ok         bool   `json:"ok"`
+	Error      string `json:"error,omitempty"`
+	HTTPStatus int    `json:"http_status,omitempty"`
+}
+
+// kickJob is a single (channel, user) pair to remove.
+type kickJob struct {
+	Channel   string
+	ChannelID string
+	Email     string
+	UserID    string
+}
+
+// kickUsersFromChannels removes each user from each channel, fanning the
+// (channel, user) pairs out across a bounded worker pool so large removals
+// don't serialize on Slack's one-user-at-a-time conversations.kick API.
+// It continues on partial failure, collecting one kickResult per pair
+// rather than aborting on the first error.
+func kickUsersFromChannels(client *slackClient, jobs []kickJob, concurrency int) []kickResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobCh := make(chan kickJob)
+	resultCh := make(chan kickResult)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				status, err := client.ConversationsKick(job.ChannelID, job.UserID)
+				result := kickResult{
+					Channel:    job.Channel,
+					ChannelID:  job.ChannelID,
+					Email:      job.Email,
+					UserID:     job.UserID,
+					Ok:         err == nil,
+					HTTPStatus: status,
+				}
+				if err != nil {
+					result.Error = err.Error()
+				}
+				resultCh <- result
+			}
+		}()
+	}
+
+	go func() {
+		for _, job := range jobs {
+			jobCh <- job
+		}
+		close(jobCh)
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultCh)
+	}()
+
+	results := make([]kickResult, 0, len(jobs))
+	for result := range resultCh {
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// printKickReport renders the aggregate removal report either as a
+// plain-text table or, when output is "json", as a JSON array so CI
+// pipelines can consume it.
+func printKickReport(results []kickResult, output string) {
+	if output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(results)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tUSER\tSTATUS\tERROR")
+	for _, result := range results {
+		status := "ok"
+		if !result.Ok {
+			status = "failed"
+		}
+		// Sync-driven kicks resolve bare user IDs from conversations.members,
+		// which carries no email; fall back to the user ID so the column
+		// isn't silently blank when the email couldn't be resolved.
+		user := result.Email
+		if user == "" {
+			user = result.UserID
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Channel, user, status, result.Error)
+	}
+	w.Flush()
+}
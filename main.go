@@ -1,391 +1,262 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"net/http"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 )
 
 const (
-	conversationsInviteURL = "https://slack.com/api/conversations.invite"
-	conversationsKickURL   = "https://slack.com/api/conversations.kick"
-	conversationsListURL   = "https://slack.com/api/conversations.list"
-	usersLookupByEmailURL  = "https://slack.com/api/users.lookupByEmail"
-
 	actionAdd    = "add"
 	actionRemove = "remove"
-)
-
-type (
-	conversationsListResponse struct {
-		Ok               bool             `json:"ok"`
-		Channels         []channel        `json:"channels"`
-		ResponseMetadata responseMetadata `json:"response_metadata"`
-		Error            string           `json:error`
-		Needed           string           `json:needed`
-		Provided         string           `json:provided`
-	}
-
-	channel struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	}
+	actionSync   = "sync"
 
-	responseMetadata struct {
-		NextCursor string `json:"next_cursor"`
-	}
+	outputTable = "table"
+	outputJSON  = "json"
 
-	conversationsInviteRequest struct {
-		ChannelID string `json:"channel"`
-		UserIDs   string `json:"users"`
-	}
-
-	conversationsInviteResponse struct {
-		Ok    bool   `json:"ok"`
-		Error string `json:"error"`
-	}
-
-	conversationsKickRequest struct {
-		ChannelID string `json:"channel"`
-		UserID    string `json:"user"`
-	}
-
-	conversationsKickResponse struct {
-		Ok    bool   `json:"ok"`
-		Error string `json:"error"`
-	}
-
-	usersLookupByEmailResponse struct {
-		Ok    bool   `json:"ok"`
-		User  user   `json:"user"`
-		Error string `json:"error"`
-	}
-
-	user struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-	}
+	defaultChannelTypes        = "public_channel"
+	defaultPrivateChannelTypes = "public_channel,private_channel"
 )
 
-// This script invites the given users to the given channels on Slack.
-// Due to the oddness of the Slack API, this is accomplished via these steps:
-// 1) Look up Slack user IDs by email
-// 2) Query all public (private if 'private' flag is set to true) channels in the workspace and create a name -> ID mapping
-// 3) For each of the given channels, invite the users (user IDs) to the channel (channel ID)
+// resolvedUser pairs the email an operator supplied with the Slack user ID
+// it resolved to.
+type resolvedUser struct {
+	Email  string
+	UserID string
+}
+
+// This script invites/removes the given users to/from the given channels
+// on Slack, or reconciles channel membership to a declarative spec file
+// (action=sync). Due to the oddness of the Slack API, add/remove is
+// accomplished via these steps:
+//  1. Look up Slack user IDs by email
+//  2. Query the requested conversation types (public_channel, and
+//     private_channel/mpim/im as requested) in a single conversations.list
+//     call and index them by name
+//  3. For each of the given channels, invite/remove the users (user IDs) to/from the channel (channel ID)
 func main() {
 	var apiToken string
 	var action string
 	var emails string
 	var channelsArg string
 	var private bool
+	var channelTypesArg string
 	var debug bool
+	var concurrency int
+	var output string
+	var specFile string
+	var dryRun bool
+	var cachePath string
+	var cacheTTL time.Duration
+	var refreshCache bool
+	var noCache bool
+	var auditLogPath string
 
 	// parse flags
 	flag.StringVar(&apiToken, "api_token", "", "Slack OAuth Access Token")
-	flag.StringVar(&action, "action", "add", "'add' to invite users, 'remove' to remove users")
-	flag.StringVar(&emails, "emails", "", "Comma separated list of Slack user emails to invite")
-	flag.StringVar(&channelsArg, "channels", "", "Comma separated list of channels to invite users to")
-	flag.BoolVar(&private, "private", false, "Boolean flag to enable private channel invitations (requires OAuth scopes 'groups:read' and 'groups:write')")
+	flag.StringVar(&action, "action", "add", "'add' to invite users, 'remove' to remove users, 'sync' to reconcile membership to a spec file")
+	flag.StringVar(&emails, "emails", "", "Comma separated list of Slack user emails to invite (action=add/remove)")
+	flag.StringVar(&channelsArg, "channels", "", "Comma separated list of channels to invite users to (action=add/remove). Prefix with '#' or 'priv:' to disambiguate a name that exists as both a public and private channel")
+	flag.BoolVar(&private, "private", false, "Boolean flag to also query private channels (requires OAuth scopes 'groups:read' and 'groups:write'); superseded by -channel-types if set")
+	flag.StringVar(&channelTypesArg, "channel-types", "", "Comma separated conversations.list types to query (public_channel,private_channel,mpim,im); overrides -private")
 	flag.BoolVar(&debug, "debug", false, "Enables debug logging when set to true")
+	flag.IntVar(&concurrency, "concurrency", 4, "Number of concurrent conversations.kick calls to make when removing users")
+	flag.StringVar(&output, "output", outputTable, "Output format for the 'remove'/'sync' kick report: 'table' or 'json'")
+	flag.StringVar(&specFile, "spec-file", "", "Path to a YAML/JSON membership spec file (action=sync)")
+	flag.BoolVar(&dryRun, "dry-run", false, "Print the planned invites/kicks without applying them (action=sync)")
+	flag.StringVar(&cachePath, "cache", defaultCachePath(), "Path to the on-disk channel/user lookup cache")
+	flag.DurationVar(&cacheTTL, "cache-ttl", defaultCacheTTL, "How long cached channel/user lookups remain valid")
+	flag.BoolVar(&refreshCache, "refresh-cache", false, "Force repopulating the lookup cache from the API")
+	flag.BoolVar(&noCache, "no-cache", false, "Disable the on-disk lookup cache entirely")
+	flag.StringVar(&auditLogPath, "audit-log", "", "Path to append a JSON-lines audit trail of invite/kick operations")
 	flag.Parse()
 
-	if apiToken == "" || emails == "" || channelsArg == "" || (action != actionAdd && action != actionRemove) {
+	if apiToken == "" || (action != actionAdd && action != actionRemove && action != actionSync) || (output != outputTable && output != outputJSON) {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// lookup users by email
-	fmt.Printf("\nLooking up users ...\n")
-	var userIDs []string
-	for _, email := range strings.Split(emails, ",") {
-		userID, err := getUserID(apiToken, email)
-		if err != nil {
-			fmt.Printf("Error while looking up user with email %s: %s\n", email, err)
-			continue
+	if action == actionSync {
+		if specFile == "" {
+			flag.Usage()
+			os.Exit(1)
 		}
-
-		fmt.Printf("Valid user (ID: %s) found for '%s'\n", userID, email)
-		userIDs = append(userIDs, userID)
-	}
-
-	if len(userIDs) == 0 {
-		fmt.Println("\nNo users found - aborting")
-		return
-	}
-
-	// get all channels
-	channelNameToIDMap, err := getChannels(apiToken, private, debug)
-	if err != nil {
-		panic(err)
+	} else if emails == "" || channelsArg == "" {
+		flag.Usage()
+		os.Exit(1)
 	}
 
+	logLevel := slog.LevelInfo
 	if debug {
-		fmt.Printf("DEBUG: Total # of channels retrieved: %d\n", len(channelNameToIDMap))
+		logLevel = slog.LevelDebug
 	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
 
-	// invite/remove users to each channel
-	if action == actionAdd {
-		fmt.Printf("\nInviting users to channels ...\n")
-	} else {
-		fmt.Printf("\nRemoving users from channels ...\n")
-	}
-	channels := strings.Split(channelsArg, ",")
-	for _, channel := range channels {
-		channelID := channelNameToIDMap[channel]
-		if channelID == "" {
-			fmt.Printf("Channel '%s' not found -- skipping\n", channel)
-			continue
-		}
+	channelTypes := resolveChannelTypes(channelTypesArg, private)
+	client := newSlackClient(apiToken, logger)
 
-		if action == actionAdd {
-			err := inviteUsersToChannel(apiToken, userIDs, channelID)
-			if err != nil {
-				fmt.Printf("Error while inviting users to %s (%s): %s\n", channel, channelID, err)
-				continue
-			}
-		} else {
-			err := removeUsersFromChannel(apiToken, userIDs, channelID, debug)
-			if err != nil {
-				fmt.Printf("Error while removing users from %s (%s): %s\n", channel, channelID, err)
-				continue
-			}
-		}
-
-		if action == actionAdd {
-			fmt.Printf("Users invited to '%s'\n", channel)
-		} else {
-			fmt.Printf("Users removed from '%s'\n", channel)
-		}
-	}
-
-	fmt.Println("\nAll done! You're welcome =)")
-}
-
-func getUserID(apiToken, userEmail string) (string, error) {
-	httpClient := &http.Client{}
-
-	// lookup user by email
-	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(usersLookupByEmailURL+"?email=%s", userEmail), nil)
+	auth, err := client.AuthTest()
 	if err != nil {
-		return "", err
+		panic(err)
 	}
 
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", apiToken))
-
-	resp, err := httpClient.Do(req)
+	cache, err := newLookupCache(client, cacheConfig{
+		enabled: !noCache,
+		path:    cachePath,
+		ttl:     cacheTTL,
+		refresh: refreshCache,
+	}, auth.TeamID)
 	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		err := printErrorResponseBody(resp)
-		if err != nil {
-			return "", err
-		}
-		return "", fmt.Errorf("Non-200 status code (%d)", resp.StatusCode)
+		panic(err)
 	}
+	defer cache.Flush()
 
-	var data usersLookupByEmailResponse
-	err = json.NewDecoder(resp.Body).Decode(&data)
+	auditLog, err := newAuditLogger(auditLogPath, auth.User, logger)
 	if err != nil {
-		return "", err
+		panic(err)
 	}
+	defer auditLog.Close()
 
-	if !data.Ok {
-		fmt.Printf("usersLookupByEmailResponse: %+v\n", data)
-		return "", fmt.Errorf("Non-ok response while looking up user by email")
+	if action == actionSync {
+		runSync(cache, auditLog, specFile, channelTypes, concurrency, dryRun, output)
+		return
 	}
 
-	// return user ID
-	return data.User.ID, nil
+	runInviteOrRemove(cache, auditLog, action, emails, channelsArg, channelTypes, logger, concurrency, output)
 }
 
-func getChannels(apiToken string, private bool, debug bool) (map[string]string, error) {
-
-	channelType := "public_channel"
+// resolveChannelTypes picks the conversations.list "types" value to
+// query: an explicit -channel-types always wins, otherwise -private
+// toggles between public-only and public+private.
+func resolveChannelTypes(channelTypesArg string, private bool) string {
+	if channelTypesArg != "" {
+		return channelTypesArg
+	}
 	if private {
-		channelType = "private_channel"
+		return defaultPrivateChannelTypes
 	}
+	return defaultChannelTypes
+}
 
-	nameToID := make(map[string]string)
-
-	httpClient := &http.Client{}
-	var nextCursor string
-	for {
-		// query list of channels
-		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf(conversationsListURL+"?cursor=%s&exclude_archived=true&limit=200&types=%s", nextCursor, channelType), nil)
-		if err != nil {
-			return nil, err
-		}
-
-		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", apiToken))
-
-		resp, err := httpClient.Do(req)
-		if err != nil {
-			return nil, err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			err := printErrorResponseBody(resp)
-			if err != nil {
-				return nil, err
-			}
-			return nil, fmt.Errorf("Non-200 status code (%d)", resp.StatusCode)
-		}
+func runInviteOrRemove(cache *lookupCache, auditLog *auditLogger, action, emails, channelsArg, channelTypes string, logger *slog.Logger, concurrency int, output string) {
+	client := cache.client
 
-		var data conversationsListResponse
-		err = json.NewDecoder(resp.Body).Decode(&data)
+	// lookup users by email
+	fmt.Printf("\nLooking up users ...\n")
+	var users []resolvedUser
+	for _, email := range strings.Split(emails, ",") {
+		userID, err := cache.UserID(email)
 		if err != nil {
-			return nil, err
-		}
-
-		if !data.Ok {
-			fmt.Printf("conversationsListResponse: %+v", data)
-			return nil, fmt.Errorf("Non-ok response while querying list of channels")
-		}
-
-		if debug {
-			fmt.Printf("DEBUG: # of channels returned in page: %d\n", len(data.Channels))
-		}
-
-		// map of channel names to IDs
-		for _, channel := range data.Channels {
-			nameToID[channel.Name] = channel.ID
+			fmt.Printf("Error while looking up user with email %s: %s\n", email, err)
+			continue
 		}
 
-		// paginate if necessary
-		nextCursor = data.ResponseMetadata.NextCursor
-		if nextCursor == "" {
-			break
-		}
+		fmt.Printf("Valid user (ID: %s) found for '%s'\n", userID, email)
+		users = append(users, resolvedUser{Email: email, UserID: userID})
 	}
 
-	return nameToID, nil
-}
-
-func inviteUsersToChannel(apiToken string, userIDs []string, channelID string) error {
-	httpClient := &http.Client{}
-
-	reqBody, err := json.Marshal(conversationsInviteRequest{
-		ChannelID: channelID,
-		UserIDs:   strings.Join(userIDs, ","),
-	})
-	if err != nil {
-		return err
+	if len(users) == 0 {
+		fmt.Println("\nNo users found - aborting")
+		return
 	}
 
-	req, err := http.NewRequest(http.MethodPost, conversationsInviteURL, bytes.NewReader(reqBody))
+	// get all channels
+	channels, err := cache.Channels(channelTypes)
 	if err != nil {
-		return err
+		panic(err)
 	}
+	channelIdx := buildChannelIndex(channels)
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", apiToken))
+	logger.Debug("channels retrieved", "count", len(channels))
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		err := printErrorResponseBody(resp)
-		if err != nil {
-			return err
+	// resolve the requested channel names to IDs, skipping any that aren't found
+	var channelNames []string
+	var channelIDs []string
+	for _, channelName := range strings.Split(channelsArg, ",") {
+		channelID, ok := channelIdx.resolve(channelName)
+		if !ok {
+			fmt.Printf("Channel '%s' not found (or ambiguous -- use '#name' or 'priv:name') -- skipping\n", channelName)
+			continue
 		}
-		return fmt.Errorf("Non-200 status code: (%d)", resp.StatusCode)
+		channelNames = append(channelNames, channelName)
+		channelIDs = append(channelIDs, channelID)
 	}
 
-	var data conversationsInviteResponse
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	if err != nil {
-		return err
-	}
-
-	if !data.Ok {
-		fmt.Printf("conversationsInviteResponse: %+v\n", data)
-		return fmt.Errorf("Non-ok response while inviting user to channel")
-	}
-
-	return nil
-}
+	if action == actionAdd {
+		fmt.Printf("\nInviting users to channels ...\n")
+		for i, channelID := range channelIDs {
+			channelName := channelNames[i]
+			userIDs := make([]string, len(users))
+			for j, u := range users {
+				userIDs[j] = u.UserID
+			}
 
-func removeUsersFromChannel(apiToken string, userIDs []string, channelID string, debug bool) error {
-	// API only supports removing users one at a time ...
-	for _, userID := range userIDs {
-		err := removeUserFromChannel(apiToken, userID, channelID)
-		if err != nil {
-			if debug {
-				fmt.Printf("DEBUG: Error while removing user %s from channel %s: %s\n", userID, channelID, err)
+			status, err := client.ConversationsInvite(channelID, userIDs)
+			auditLog.LogInvite(channelName, channelID, users, status, err)
+			if err != nil {
+				fmt.Printf("Error while inviting users to %s (%s): %s\n", channelName, channelID, err)
+				continue
 			}
-			return err
+			fmt.Printf("Users invited to '%s'\n", channelName)
 		}
+	} else {
+		fmt.Printf("\nRemoving users from channels ...\n")
+		var jobs []kickJob
+		for i, channelID := range channelIDs {
+			for _, u := range users {
+				jobs = append(jobs, kickJob{
+					Channel:   channelNames[i],
+					ChannelID: channelID,
+					Email:     u.Email,
+					UserID:    u.UserID,
+				})
+			}
+		}
+
+		results := kickUsersFromChannels(client, jobs, concurrency)
+		for _, result := range results {
+			auditLog.LogKick(result)
+		}
+		fmt.Println()
+		printKickReport(results, output)
 	}
-	return nil
-}
 
-func removeUserFromChannel(apiToken string, userID string, channelID string) error {
-	httpClient := &http.Client{}
+	fmt.Println("\nAll done! You're welcome =)")
+}
 
-	reqBody, err := json.Marshal(conversationsKickRequest{
-		ChannelID: channelID,
-		UserID:    userID,
-	})
+// runSync reconciles channel membership to the spec loaded from specFile.
+func runSync(cache *lookupCache, auditLog *auditLogger, specFile, channelTypes string, concurrency int, dryRun bool, output string) {
+	spec, err := loadSyncSpec(specFile)
 	if err != nil {
-		return err
+		panic(err)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, conversationsKickURL, bytes.NewReader(reqBody))
+	channels, err := cache.Channels(channelTypes)
 	if err != nil {
-		return err
+		panic(err)
 	}
+	channelIdx := buildChannelIndex(channels)
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", apiToken))
-
-	resp, err := httpClient.Do(req)
+	plans, err := planSync(cache, spec, channelIdx)
 	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		err := printErrorResponseBody(resp)
-		if err != nil {
-			return err
-		}
-		return fmt.Errorf("Non-200 status code: (%d)", resp.StatusCode)
+		panic(err)
 	}
 
-	var data conversationsKickResponse
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	if err != nil {
-		return err
-	}
+	fmt.Println("\nPlanned changes:")
+	printSyncPlan(plans)
 
-	if !data.Ok {
-		fmt.Printf("conversationsKickResponse: %+v\n", data)
-		return fmt.Errorf("Non-ok response while removing user from channel")
+	if dryRun {
+		fmt.Println("\nDry run - no changes applied")
+		return
 	}
 
-	return nil
-}
+	fmt.Println("\nApplying changes ...")
+	results := applySyncPlan(cache.client, plans, concurrency, auditLog)
+	fmt.Println()
+	printKickReport(results, output)
 
-func printErrorResponseBody(resp *http.Response) error {
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	fmt.Println(string(bodyBytes))
-
-	return nil
+	fmt.Println("\nAll done! You're welcome =)")
 }
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	usersLookupByEmailURL   = "https://slack.com/api/users.lookupByEmail"
+	conversationsListURL    = "https://slack.com/api/conversations.list"
+	conversationsMembersURL = "https://slack.com/api/conversations.members"
+	conversationsInviteURL  = "https://slack.com/api/conversations.invite"
+	conversationsKickURL    = "https://slack.com/api/conversations.kick"
+	authTestURL             = "https://slack.com/api/auth.test"
+
+	maxRetries  = 5
+	baseBackoff = 500 * time.Millisecond
+	maxBackoff  = 30 * time.Second
+)
+
+type (
+	conversationsListResponse struct {
+		Ok               bool             `json:"ok"`
+		Channels         []channel        `json:"channels"`
+		ResponseMetadata responseMetadata `json:"response_metadata"`
+		Error            string           `json:"error"`
+		Needed           string           `json:"needed"`
+		Provided         string           `json:"provided"`
+	}
+
+	channel struct {
+		ID        string `json:"id"`
+		Name      string `json:"name"`
+		IsPrivate bool   `json:"is_private"`
+	}
+
+	responseMetadata struct {
+		NextCursor string `json:"next_cursor"`
+	}
+
+	conversationsMembersResponse struct {
+		Ok               bool             `json:"ok"`
+		Members          []string         `json:"members"`
+		ResponseMetadata responseMetadata `json:"response_metadata"`
+		Error            string           `json:"error"`
+	}
+
+	conversationsInviteRequest struct {
+		ChannelID string `json:"channel"`
+		UserIDs   string `json:"users"`
+	}
+
+	conversationsInviteResponse struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	conversationsKickRequest struct {
+		ChannelID string `json:"channel"`
+		UserID    string `json:"user"`
+	}
+
+	conversationsKickResponse struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+
+	usersLookupByEmailResponse struct {
+		Ok    bool   `json:"ok"`
+		User  user   `json:"user"`
+		Error string `json:"error"`
+	}
+
+	user struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+
+	authTestResponse struct {
+		Ok     bool   `json:"ok"`
+		TeamID string `json:"team_id"`
+		User   string `json:"user"`
+		UserID string `json:"user_id"`
+		Error  string `json:"error"`
+	}
+
+	// slackOkResponse is the subset of a Slack Web API response needed to
+	// detect rate-limiting and generic ok:false errors before a response is
+	// unmarshalled into its concrete type.
+	slackOkResponse struct {
+		Ok    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+)
+
+// slackClient owns a single http.Client shared across all Slack Web API
+// calls. It centralizes retry/backoff behavior so callers don't each have
+// to reimplement rate limit handling: HTTP 429 responses honor Slack's
+// Retry-After header, 5xx responses and ok:false/"ratelimited" responses
+// back off exponentially with jitter, and everything else is a terminal
+// error.
+type slackClient struct {
+	apiToken   string
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+func newSlackClient(apiToken string, logger *slog.Logger) *slackClient {
+	return &slackClient{
+		apiToken:   apiToken,
+		httpClient: &http.Client{},
+		logger:     logger,
+	}
+}
+
+// do issues a single Slack API request, transparently retrying on 429s,
+// 5xx responses, and ok:false "ratelimited" errors. body may be nil for
+// GET requests. It returns the raw response body and HTTP status code of
+// the call that ultimately succeeded (or the last one attempted, for a
+// terminal error without a response).
+func (c *slackClient) do(method, reqURL string, body []byte) ([]byte, int, error) {
+	for attempt := 0; ; attempt++ {
+		var bodyReader *bytes.Reader
+		if body != nil {
+			bodyReader = bytes.NewReader(body)
+		} else {
+			bodyReader = bytes.NewReader(nil)
+		}
+
+		req, err := http.NewRequest(method, reqURL, bodyReader)
+		if err != nil {
+			return nil, 0, err
+		}
+		if body != nil {
+			req.Header.Add("Content-Type", "application/json")
+		} else {
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		}
+		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", c.apiToken))
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			if attempt >= maxRetries {
+				return nil, 0, err
+			}
+			c.sleep(backoffDuration(attempt), fmt.Sprintf("request error: %s", err))
+			continue
+		}
+
+		respBody, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, resp.StatusCode, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			if attempt >= maxRetries {
+				return nil, resp.StatusCode, fmt.Errorf("rate limited (429) after %d retries", attempt)
+			}
+			c.sleep(retryAfterDuration(resp.Header.Get("Retry-After"), attempt), "rate limited (429)")
+			continue
+		}
+
+		if resp.StatusCode >= 500 {
+			if attempt >= maxRetries {
+				return nil, resp.StatusCode, fmt.Errorf("non-200 status code (%d) after %d retries: %s", resp.StatusCode, attempt, string(respBody))
+			}
+			c.sleep(backoffDuration(attempt), fmt.Sprintf("server error (%d)", resp.StatusCode))
+			continue
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, resp.StatusCode, fmt.Errorf("non-200 status code (%d): %s", resp.StatusCode, string(respBody))
+		}
+
+		var probe slackOkResponse
+		if err := json.Unmarshal(respBody, &probe); err != nil {
+			return nil, resp.StatusCode, err
+		}
+		if !probe.Ok && probe.Error == "ratelimited" {
+			if attempt >= maxRetries {
+				return nil, resp.StatusCode, fmt.Errorf("ratelimited after %d retries", attempt)
+			}
+			c.sleep(backoffDuration(attempt), "ok:false ratelimited")
+			continue
+		}
+
+		return respBody, resp.StatusCode, nil
+	}
+}
+
+func (c *slackClient) sleep(d time.Duration, reason string) {
+	c.logger.Debug(reason, "wait", d)
+	time.Sleep(d)
+}
+
+// backoffDuration returns an exponentially increasing delay (capped at
+// maxBackoff) with up to 50% jitter, so that many concurrent callers
+// don't retry in lockstep.
+func backoffDuration(attempt int) time.Duration {
+	d := baseBackoff * time.Duration(1<<uint(attempt))
+	if d > maxBackoff {
+		d = maxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// retryAfterDuration honors Slack's Retry-After header (in seconds) when
+// present, falling back to backoffDuration otherwise.
+func retryAfterDuration(header string, attempt int) time.Duration {
+	if header != "" {
+		if secs, err := strconv.Atoi(header); err == nil {
+			return time.Duration(secs) * time.Second
+		}
+	}
+	return backoffDuration(attempt)
+}
+
+// AuthTest returns the workspace's team ID and the authenticated actor
+// (user or bot name) via auth.test. It's used to key the on-disk lookup
+// cache per workspace and to identify the actor in the audit log.
+func (c *slackClient) AuthTest() (authTestResponse, error) {
+	respBody, _, err := c.do(http.MethodGet, authTestURL, nil)
+	if err != nil {
+		return authTestResponse{}, err
+	}
+
+	var data authTestResponse
+	if err := json.Unmarshal(respBody, &data); err != nil {
+		return authTestResponse{}, err
+	}
+	if !data.Ok {
+		return authTestResponse{}, fmt.Errorf("non-ok response from auth.test: %s", data.Error)
+	}
+
+	return data, nil
+}
+
+// UsersLookupByEmail looks up a Slack user ID by email via
+// users.lookupByEmail.
+func (c *slackClient) UsersLookupByEmail(email string) (string, error) {
+	reqURL := fmt.Sprintf("%s?email=%s", usersLookupByEmailURL, url.QueryEscape(email))
+
+	respBody, _, err := c.do(http.MethodGet, reqURL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var data usersLookupByEmailResponse
+	if err := json.Unmarshal(respBody, &data); err != nil {
+		return "", err
+	}
+	if !data.Ok {
+		return "", fmt.Errorf("non-ok response while looking up user by email: %s", data.Error)
+	}
+
+	return data.User.ID, nil
+}
+
+// ConversationsList pages through conversations.list for the given
+// comma-separated set of channel types (e.g.
+// "public_channel,private_channel,mpim,im") and returns the channels
+// found, deduplicated by ID. A single call covering multiple types avoids
+// having to invoke conversations.list once per type for mixed
+// public/private workspaces.
+func (c *slackClient) ConversationsList(channelTypes string) ([]channel, error) {
+	seen := make(map[string]bool)
+	var channels []channel
+
+	var nextCursor string
+	for {
+		reqURL := fmt.Sprintf(conversationsListURL+"?cursor=%s&exclude_archived=true&limit=200&types=%s", nextCursor, channelTypes)
+
+		respBody, _, err := c.do(http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var data conversationsListResponse
+		if err := json.Unmarshal(respBody, &data); err != nil {
+			return nil, err
+		}
+		if !data.Ok {
+			return nil, fmt.Errorf("non-ok response while querying list of channels: %s", data.Error)
+		}
+
+		c.logger.Debug("conversations.list page", "count", len(data.Channels))
+
+		for _, ch := range data.Channels {
+			if seen[ch.ID] {
+				continue
+			}
+			seen[ch.ID] = true
+			channels = append(channels, ch)
+		}
+
+		nextCursor = data.ResponseMetadata.NextCursor
+		if nextCursor == "" {
+			break
+		}
+	}
+
+	return channels, nil
+}
+
+// ConversationsMembers pages through conversations.members for channelID
+// and returns the full set of member user IDs.
+func (c *slackClient) ConversationsMembers(channelID string) ([]string, error) {
+	var members []string
+
+	var nextCursor string
+	for {
+		reqURL := fmt.Sprintf(conversationsMembersURL+"?channel=%s&cursor=%s&limit=200", channelID, nextCursor)
+
+		respBody, _, err := c.do(http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var data conversationsMembersResponse
+		if err := json.Unmarshal(respBody, &data); err != nil {
+			return nil, err
+		}
+		if !data.Ok {
+			return nil, fmt.Errorf("non-ok response while querying channel members: %s", data.Error)
+		}
+
+		members = append(members, data.Members...)
+
+		nextCursor = data.ResponseMetadata.NextCursor
+		if nextCursor == "" {
+			break
+		}
+	}
+
+	return members, nil
+}
+
+// ConversationsInvite invites userIDs to channelID via
+// conversations.invite. It returns the HTTP status code of the call, for
+// callers that want to record it (e.g. the audit log).
+func (c *slackClient) ConversationsInvite(channelID string, userIDs []string) (int, error) {
+	reqBody, err := json.Marshal(conversationsInviteRequest{
+		ChannelID: channelID,
+		UserIDs:   strings.Join(userIDs, ","),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	respBody, status, err := c.do(http.MethodPost, conversationsInviteURL, reqBody)
+	if err != nil {
+		return status, err
+	}
+
+	var data conversationsInviteResponse
+	if err := json.Unmarshal(respBody, &data); err != nil {
+		return status, err
+	}
+	if !data.Ok {
+		return status, fmt.Errorf("non-ok response while inviting user to channel: %s", data.Error)
+	}
+
+	return status, nil
+}
+
+// ConversationsKick removes userID from channelID via conversations.kick.
+// Slack's API only supports removing one user at a time. It returns the
+// HTTP status code of the call, for callers that want to record it (e.g.
+// the audit log).
+func (c *slackClient) ConversationsKick(channelID, userID string) (int, error) {
+	reqBody, err := json.Marshal(conversationsKickRequest{
+		ChannelID: channelID,
+		UserID:    userID,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	respBody, status, err := c.do(http.MethodPost, conversationsKickURL, reqBody)
+	if err != nil {
+		return status, err
+	}
+
+	var data conversationsKickResponse
+	if err := json.Unmarshal(respBody, &data); err != nil {
+		return status, err
+	}
+	if !data.Ok {
+		return status, fmt.Errorf("non-ok response while removing user from channel: %s", data.Error)
+	}
+
+	return status, nil
+}
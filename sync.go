@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// syncSpec is the declarative description of desired channel membership
+// used by action=sync. Channels maps a channel name to the emails that
+// should be members of it. Defaults lists emails that should belong to
+// every channel in the spec, and Exclude lists emails that must never be
+// added (and should be removed if present), regardless of Channels or
+// Defaults.
+type syncSpec struct {
+	Defaults []string            `yaml:"defaults" json:"defaults"`
+	Exclude  []string            `yaml:"exclude" json:"exclude"`
+	Channels map[string][]string `yaml:"channels" json:"channels"`
+}
+
+// loadSyncSpec reads a syncSpec from a YAML or JSON file. The format is
+// chosen by file extension (.json vs anything else defaulting to YAML);
+// JSON is a subset of YAML so a .yaml/.yml extension is not required.
+func loadSyncSpec(path string) (*syncSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var spec syncSpec
+	if strings.HasSuffix(path, ".json") {
+		if err := json.Unmarshal(data, &spec); err != nil {
+			return nil, fmt.Errorf("parsing %s as JSON: %w", path, err)
+		}
+	} else if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("parsing %s as YAML: %w", path, err)
+	}
+
+	return &spec, nil
+}
+
+// channelPlan is the add/remove diff computed for a single channel.
+type channelPlan struct {
+	Channel   string
+	ChannelID string
+	ToInvite  []resolvedUser // users to invite
+	ToKick    []resolvedUser // users to remove; Email is best-effort (see planSync)
+}
+
+// planSync resolves spec against the current state of the workspace
+// (the channel index and each channel's current members) and returns the
+// add/remove diff per channel, without applying it.
+func planSync(cache *lookupCache, spec *syncSpec, channelIdx *channelIndex) ([]channelPlan, error) {
+	exclude := make(map[string]bool, len(spec.Exclude))
+	for _, email := range spec.Exclude {
+		exclude[email] = true
+	}
+
+	channelNames := make([]string, 0, len(spec.Channels))
+	for channelName := range spec.Channels {
+		channelNames = append(channelNames, channelName)
+	}
+	sort.Strings(channelNames)
+
+	var plans []channelPlan
+	for _, channelName := range channelNames {
+		channelID, ok := channelIdx.resolve(channelName)
+		if !ok {
+			fmt.Printf("Channel '%s' not found (or ambiguous -- use '#name' or 'priv:name') -- skipping\n", channelName)
+			continue
+		}
+
+		desired := make(map[string]string) // userID -> email
+		for _, email := range append(append([]string{}, spec.Defaults...), spec.Channels[channelName]...) {
+			if exclude[email] {
+				continue
+			}
+			userID, err := cache.UserID(email)
+			if err != nil {
+				// A failed lookup is NOT the same as "not desired": treating
+				// it as such would make this user's current membership look
+				// unwanted and queue them for kicking. Abort the whole plan
+				// instead of computing kicks against an incomplete desired set.
+				return nil, fmt.Errorf("looking up user with email %s: %w", email, err)
+			}
+			desired[userID] = email
+		}
+
+		currentMembers, err := cache.client.ConversationsMembers(channelID)
+		if err != nil {
+			return nil, fmt.Errorf("fetching members of %s: %w", channelName, err)
+		}
+		current := make(map[string]bool, len(currentMembers))
+		for _, userID := range currentMembers {
+			current[userID] = true
+		}
+
+		plan := channelPlan{Channel: channelName, ChannelID: channelID}
+		for userID, email := range desired {
+			if !current[userID] {
+				plan.ToInvite = append(plan.ToInvite, resolvedUser{Email: email, UserID: userID})
+			}
+		}
+		for userID := range current {
+			if _, ok := desired[userID]; !ok {
+				// conversations.members only returns bare user IDs, so the
+				// email here is only known if this user was already looked
+				// up (and cached) by email elsewhere; it's left blank
+				// otherwise rather than guessed at.
+				email, _ := cache.EmailForUserID(userID)
+				plan.ToKick = append(plan.ToKick, resolvedUser{Email: email, UserID: userID})
+			}
+		}
+		sort.Slice(plan.ToInvite, func(i, j int) bool { return plan.ToInvite[i].UserID < plan.ToInvite[j].UserID })
+		sort.Slice(plan.ToKick, func(i, j int) bool { return plan.ToKick[i].UserID < plan.ToKick[j].UserID })
+
+		plans = append(plans, plan)
+	}
+
+	return plans, nil
+}
+
+// printSyncPlan prints the planned invites/kicks for each channel.
+func printSyncPlan(plans []channelPlan) {
+	for _, plan := range plans {
+		fmt.Printf("\n%s (%s):\n", plan.Channel, plan.ChannelID)
+		if len(plan.ToInvite) == 0 && len(plan.ToKick) == 0 {
+			fmt.Println("  (in sync)")
+			continue
+		}
+		for _, u := range plan.ToInvite {
+			fmt.Printf("  + invite %s (%s)\n", u.Email, u.UserID)
+		}
+		for _, u := range plan.ToKick {
+			if u.Email != "" {
+				fmt.Printf("  - kick %s (%s)\n", u.Email, u.UserID)
+			} else {
+				fmt.Printf("  - kick %s (email unknown)\n", u.UserID)
+			}
+		}
+	}
+}
+
+// applySyncPlan invites and kicks users per plan, fanning kicks out
+// across a bounded worker pool the same way action=remove does. Invite
+// and kick operations are recorded to auditLog as they happen.
+func applySyncPlan(client *slackClient, plans []channelPlan, concurrency int, auditLog *auditLogger) []kickResult {
+	var jobs []kickJob
+	for _, plan := range plans {
+		if len(plan.ToInvite) > 0 {
+			userIDs := make([]string, len(plan.ToInvite))
+			for i, u := range plan.ToInvite {
+				userIDs[i] = u.UserID
+			}
+
+			status, err := client.ConversationsInvite(plan.ChannelID, userIDs)
+			if err != nil {
+				fmt.Printf("Error while inviting users to %s (%s): %s\n", plan.Channel, plan.ChannelID, err)
+			}
+			auditLog.LogInvite(plan.Channel, plan.ChannelID, plan.ToInvite, status, err)
+		}
+		for _, u := range plan.ToKick {
+			jobs = append(jobs, kickJob{Channel: plan.Channel, ChannelID: plan.ChannelID, Email: u.Email, UserID: u.UserID})
+		}
+	}
+
+	results := kickUsersFromChannels(client, jobs, concurrency)
+	for _, result := range results {
+		auditLog.LogKick(result)
+	}
+	return results
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// redirectTransport rewrites every request's scheme/host to point at a
+// local httptest server, leaving the path and query (and therefore the
+// slack.com/api/... routing baked into slack.go's URL constants) intact.
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	req.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// newTestSlackClient spins up an httptest server serving handler and
+// returns a slackClient that transparently talks to it instead of the
+// real Slack API.
+func newTestSlackClient(t *testing.T, handler http.HandlerFunc) *slackClient {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	target, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("parsing test server URL: %s", err)
+	}
+
+	return &slackClient{
+		apiToken:   "test-token",
+		httpClient: &http.Client{Transport: redirectTransport{target: target}},
+		logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// fakeSlackAPI serves just enough of users.lookupByEmail and
+// conversations.members for planSync's tests: userIDs maps looked-up
+// emails to the ID returned, and members maps a channel ID to its
+// current membership. An email not in userIDs yields a non-ok response,
+// matching a real lookup failure.
+func fakeSlackAPI(userIDs map[string]string, members map[string][]string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "users.lookupByEmail"):
+			email := r.URL.Query().Get("email")
+			userID, ok := userIDs[email]
+			if !ok {
+				json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": "users_not_found"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "user": map[string]string{"id": userID}})
+		case strings.Contains(r.URL.Path, "conversations.members"):
+			channelID := r.URL.Query().Get("channel")
+			json.NewEncoder(w).Encode(map[string]any{"ok": true, "members": members[channelID]})
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func newTestCache(client *slackClient) *lookupCache {
+	return &lookupCache{
+		client:        client,
+		cfg:           cacheConfig{enabled: false, ttl: time.Hour},
+		team:          &teamCache{},
+		userIDToEmail: make(map[string]string),
+	}
+}
+
+func TestPlanSyncDefaultsAndExclude(t *testing.T) {
+	userIDs := map[string]string{
+		"default@x.com": "U1",
+		"member@x.com":  "U3",
+	}
+	members := map[string][]string{
+		"C1": {"U1", "U9"}, // U1 (default@x.com) stays, U9 is unwanted, member@x.com (U3) not yet present
+	}
+	client := newTestSlackClient(t, fakeSlackAPI(userIDs, members))
+	cache := newTestCache(client)
+
+	spec := &syncSpec{
+		Defaults: []string{"default@x.com"},
+		Exclude:  []string{"excluded@x.com"},
+		Channels: map[string][]string{
+			"general": {"member@x.com", "excluded@x.com"},
+		},
+	}
+	idx := buildChannelIndex([]channel{{ID: "C1", Name: "general"}})
+
+	plans, err := planSync(cache, spec, idx)
+	if err != nil {
+		t.Fatalf("planSync returned error: %s", err)
+	}
+	if len(plans) != 1 {
+		t.Fatalf("got %d plans, want 1", len(plans))
+	}
+
+	plan := plans[0]
+	if len(plan.ToInvite) != 1 || plan.ToInvite[0].UserID != "U3" || plan.ToInvite[0].Email != "member@x.com" {
+		t.Errorf("ToInvite = %+v, want [{member@x.com U3}]", plan.ToInvite)
+	}
+	if len(plan.ToKick) != 1 || plan.ToKick[0].UserID != "U9" {
+		t.Errorf("ToKick = %+v, want [{UserID: U9}]", plan.ToKick)
+	}
+	// excluded@x.com must never be desired, even though it's listed under
+	// the channel -- and since it's never looked up, it can't have ended
+	// up kicked either (it isn't a current member here).
+	for _, u := range plan.ToInvite {
+		if u.Email == "excluded@x.com" {
+			t.Errorf("excluded@x.com should never be invited")
+		}
+	}
+}
+
+func TestPlanSyncAbortsOnLookupFailure(t *testing.T) {
+	userIDs := map[string]string{
+		"ok@x.com": "U1",
+		// "flaky@x.com" deliberately absent, simulating a failed lookup.
+	}
+	members := map[string][]string{"C1": {"U1"}}
+	client := newTestSlackClient(t, fakeSlackAPI(userIDs, members))
+	cache := newTestCache(client)
+
+	spec := &syncSpec{
+		Channels: map[string][]string{
+			"general": {"ok@x.com", "flaky@x.com"},
+		},
+	}
+	idx := buildChannelIndex([]channel{{ID: "C1", Name: "general"}})
+
+	plans, err := planSync(cache, spec, idx)
+	if err == nil {
+		t.Fatalf("planSync returned no error, want an abort on the failed lookup of flaky@x.com")
+	}
+	if plans != nil {
+		t.Errorf("planSync returned plans alongside an error: %+v", plans)
+	}
+}
+
+func TestPlanSyncUnknownChannelSkipped(t *testing.T) {
+	client := newTestSlackClient(t, fakeSlackAPI(nil, nil))
+	cache := newTestCache(client)
+
+	spec := &syncSpec{Channels: map[string][]string{"nope": {}}}
+	idx := buildChannelIndex(nil)
+
+	plans, err := planSync(cache, spec, idx)
+	if err != nil {
+		t.Fatalf("planSync returned error: %s", err)
+	}
+	if len(plans) != 0 {
+		t.Errorf("got %d plans, want 0 for an unresolvable channel", len(plans))
+	}
+}